@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// CoverMode selects how cover art is extracted from the source video.
+type CoverMode string
+
+const (
+	CoverModeStill    CoverMode = "still"     // single JPEG frame (the original behavior)
+	CoverModeAPNG     CoverMode = "apng"      // animated PNG sidecar
+	CoverModeGIF      CoverMode = "gif"       // animated GIF sidecar, palette-optimized
+	CoverModeMP4Thumb CoverMode = "mp4-thumb" // silent MP4 thumbnail clip sidecar
+)
+
+// parseCoverMode validates a --cover-mode flag value.
+func parseCoverMode(s string) (CoverMode, error) {
+	switch CoverMode(s) {
+	case CoverModeStill, CoverModeAPNG, CoverModeGIF, CoverModeMP4Thumb:
+		return CoverMode(s), nil
+	default:
+		return "", fmt.Errorf("unsupported cover mode %q (want still, apng, gif, or mp4-thumb)", s)
+	}
+}
+
+// coverOptions controls cover/thumbnail extraction for one file.
+type coverOptions struct {
+	mode          CoverMode
+	startTime     float64 // --cover-start, seconds into the video
+	frameCount    int     // --cover-frames, frames sampled for animated modes
+	frameInterval float64 // --cover-interval, seconds between sampled frames
+	grid          bool    // --cover-grid, also emit a contact-sheet preview
+}
+
+// coverResult is what extractCover produced for one file.
+type coverResult struct {
+	stillPath   string // always set: a single JPEG used as embedded cover art
+	sidecarPath string // set for animated modes: the apng/gif/mp4 file
+	gridPath    string // set when opts.grid is true: a contact-sheet JPEG
+}
+
+// extractCover pulls a still JPEG frame (for embedding, since MP3/M4A
+// cover art must be a static image) and, for animated cover modes, an
+// additional animated sidecar next to the eventual audio output.
+func extractCover(ctx context.Context, ffmpegPath, videoPath, tempDir, baseName string, opts coverOptions) (coverResult, error) {
+	var result coverResult
+
+	result.stillPath = filepath.Join(tempDir, baseName+"-cover.jpg")
+	startTime := fmt.Sprintf("%f", opts.startTime)
+	cmdStill := exec.CommandContext(ctx, ffmpegPath,
+		"-ss", startTime,
+		"-i", videoPath,
+		"-vframes", "1",
+		"-vf", "scale=1024:-1",
+		"-q:v", "1",
+		"-qmin", "1",
+		"-qmax", "1",
+		"-y",
+		result.stillPath)
+	if err := cmdStill.Run(); err != nil {
+		return coverResult{}, fmt.Errorf("failed to extract cover: %v", err)
+	}
+
+	switch opts.mode {
+	case CoverModeAPNG:
+		sidecar := filepath.Join(tempDir, baseName+"-cover.png")
+		if err := extractAPNG(ctx, ffmpegPath, videoPath, sidecar, opts); err != nil {
+			return coverResult{}, err
+		}
+		result.sidecarPath = sidecar
+	case CoverModeGIF:
+		sidecar := filepath.Join(tempDir, baseName+"-cover.gif")
+		if err := extractGIF(ctx, ffmpegPath, videoPath, sidecar, opts); err != nil {
+			return coverResult{}, err
+		}
+		result.sidecarPath = sidecar
+	case CoverModeMP4Thumb:
+		sidecar := filepath.Join(tempDir, baseName+"-thumb.mp4")
+		if err := extractMP4Thumb(ctx, ffmpegPath, videoPath, sidecar, opts); err != nil {
+			return coverResult{}, err
+		}
+		result.sidecarPath = sidecar
+	}
+
+	if opts.grid {
+		grid := filepath.Join(tempDir, baseName+"-contact.jpg")
+		if err := extractContactSheet(ctx, ffmpegPath, videoPath, grid, opts); err != nil {
+			return coverResult{}, err
+		}
+		result.gridPath = grid
+	}
+
+	return result, nil
+}
+
+func extractAPNG(ctx context.Context, ffmpegPath, videoPath, destPath string, opts coverOptions) error {
+	startTime := fmt.Sprintf("%f", opts.startTime)
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-ss", startTime,
+		"-i", videoPath,
+		"-vf", fmt.Sprintf("fps=1/%f,scale=480:-1", opts.frameInterval),
+		"-frames:v", fmt.Sprintf("%d", opts.frameCount),
+		"-plays", "0",
+		"-f", "apng",
+		"-y",
+		destPath)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to extract animated cover: %v", err)
+	}
+	return nil
+}
+
+// extractGIF renders a palette-optimized GIF using ffmpeg's two-pass
+// palettegen/paletteuse technique for much better quality than a naive
+// single-pass GIF encode.
+func extractGIF(ctx context.Context, ffmpegPath, videoPath, destPath string, opts coverOptions) error {
+	palettePath := destPath + ".palette.png"
+	defer os.Remove(palettePath)
+
+	startTime := fmt.Sprintf("%f", opts.startTime)
+	fps := fmt.Sprintf("fps=1/%f,scale=480:-1", opts.frameInterval)
+
+	cmdPalette := exec.CommandContext(ctx, ffmpegPath,
+		"-ss", startTime,
+		"-i", videoPath,
+		"-frames:v", fmt.Sprintf("%d", opts.frameCount),
+		"-vf", fps+",palettegen",
+		"-y",
+		palettePath)
+	if err := cmdPalette.Run(); err != nil {
+		return fmt.Errorf("failed to generate GIF palette: %v", err)
+	}
+
+	cmdGIF := exec.CommandContext(ctx, ffmpegPath,
+		"-ss", startTime,
+		"-i", videoPath,
+		"-i", palettePath,
+		"-frames:v", fmt.Sprintf("%d", opts.frameCount),
+		"-lavfi", fmt.Sprintf("%s[x];[x][1:v]paletteuse", fps),
+		"-y",
+		destPath)
+	if err := cmdGIF.Run(); err != nil {
+		return fmt.Errorf("failed to encode GIF: %v", err)
+	}
+	return nil
+}
+
+func extractMP4Thumb(ctx context.Context, ffmpegPath, videoPath, destPath string, opts coverOptions) error {
+	startTime := fmt.Sprintf("%f", opts.startTime)
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-ss", startTime,
+		"-i", videoPath,
+		"-vf", fmt.Sprintf("fps=1/%f,scale=480:-1", opts.frameInterval),
+		"-frames:v", fmt.Sprintf("%d", opts.frameCount),
+		"-an",
+		"-c:v", "libx264",
+		"-pix_fmt", "yuv420p",
+		"-y",
+		destPath)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to encode MP4 thumbnail: %v", err)
+	}
+	return nil
+}
+
+// gridCols/gridRows size the contact-sheet tile. They're deliberately not
+// derived from --cover-frames: that flag means "total frame count" for the
+// apng/gif/mp4-thumb modes, and reusing it here would make the grid's actual
+// frame count depend on --cover-frames instead of staying fixed at
+// gridCols*gridRows. Sampling by --cover-interval instead keeps the two
+// flags from silently interacting.
+const (
+	gridCols = 5
+	gridRows = 5
+)
+
+// extractContactSheet composites a gridCols x gridRows grid of frames
+// sampled every opts.frameInterval seconds into a single static preview
+// image via the tile filter.
+func extractContactSheet(ctx context.Context, ffmpegPath, videoPath, destPath string, opts coverOptions) error {
+	startTime := fmt.Sprintf("%f", opts.startTime)
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-ss", startTime,
+		"-i", videoPath,
+		"-vf", fmt.Sprintf("fps=1/%f,scale=320:-1,tile=%dx%d", opts.frameInterval, gridCols, gridRows),
+		"-frames:v", "1",
+		"-y",
+		destPath)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to build cover grid: %v", err)
+	}
+	return nil
+}
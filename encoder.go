@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Format identifies an output audio codec/container.
+type Format string
+
+const (
+	FormatMP3  Format = "mp3"
+	FormatAAC  Format = "aac"
+	FormatOpus Format = "opus"
+	FormatFLAC Format = "flac"
+)
+
+// parseFormat validates a --format flag value.
+func parseFormat(s string) (Format, error) {
+	switch Format(s) {
+	case FormatMP3, FormatAAC, FormatOpus, FormatFLAC:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("unsupported format %q (want mp3, aac, opus, or flac)", s)
+	}
+}
+
+// encodeFlags holds the user-selected format/quality flags, independent of
+// any particular file being converted.
+type encodeFlags struct {
+	format     Format
+	bitrate    string
+	vbrQuality string
+	sampleRate int
+	threads    int // --ffmpeg-threads; 0 leaves ffmpeg's own default
+}
+
+// encodeParams carries everything an encoder needs to build its ffmpeg
+// invocation for a single file.
+type encodeParams struct {
+	videoPath  string
+	coverPath  string
+	outputPath string
+	title      string
+	bitrate    string // e.g. "192k"; empty means the codec's default (VBR -q:a for mp3, 192k for aac, 128k for opus; flac ignores it)
+	vbrQuality string // libmp3lame -q:a style value, mp3 only
+	sampleRate int    // 0 means "leave at source rate"
+	threads    int    // -threads N; 0 leaves ffmpeg's own default
+
+	// Set for --split output: trims the source to [startSec, endSec) and
+	// tags the result as track trackNum of trackTotal.
+	startSec, endSec     float64
+	trackNum, trackTotal int
+}
+
+// trimArgs returns the -ss/-to seek arguments for a chapter/track split, or
+// nil for a normal whole-file conversion.
+func (p encodeParams) trimArgs() []string {
+	if p.trackTotal == 0 {
+		return nil
+	}
+	return []string{"-ss", fmt.Sprintf("%f", p.startSec), "-to", fmt.Sprintf("%f", p.endSec)}
+}
+
+// trackMetadataArgs returns the -metadata track=N/total arguments for a
+// chapter/track split, or nil for a normal whole-file conversion.
+func (p encodeParams) trackMetadataArgs() []string {
+	if p.trackTotal == 0 {
+		return nil
+	}
+	return []string{"-metadata", fmt.Sprintf("track=%d/%d", p.trackNum, p.trackTotal)}
+}
+
+// encoder builds the ffmpeg command for one output codec and, for
+// containers ffmpeg can't attach cover art to directly, embeds the cover
+// as a follow-up step.
+type encoder interface {
+	// extension is the output file extension, without a leading dot.
+	extension() string
+	// buildCmd returns the ffmpeg command that produces the final output,
+	// bound to ctx so canceling it kills the running ffmpeg process.
+	// Implementations that can't mux the cover directly (opus, flac) omit
+	// it here and attach it in embedCover instead.
+	buildCmd(ctx context.Context, ffmpegPath string, p encodeParams) *exec.Cmd
+	// embedCover attaches p.coverPath to the already-encoded p.outputPath.
+	// A no-op for codecs whose buildCmd already muxed the cover.
+	embedCover(ctx context.Context, ffmpegPath string, p encodeParams) error
+}
+
+// newEncoder returns the encoder for format.
+func newEncoder(format Format) (encoder, error) {
+	switch format {
+	case FormatMP3:
+		return mp3Encoder{}, nil
+	case FormatAAC:
+		return aacEncoder{}, nil
+	case FormatOpus:
+		return opusEncoder{}, nil
+	case FormatFLAC:
+		return flacEncoder{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func sampleRateArgs(sampleRate int) []string {
+	if sampleRate <= 0 {
+		return nil
+	}
+	return []string{"-ar", fmt.Sprintf("%d", sampleRate)}
+}
+
+// threadArgs caps the threads ffmpeg itself may use for one encode, so
+// --jobs * --ffmpeg-threads stays within the machine's actual CPU budget.
+func threadArgs(threads int) []string {
+	if threads <= 0 {
+		return nil
+	}
+	return []string{"-threads", fmt.Sprintf("%d", threads)}
+}
+
+// mp3Encoder produces an MP3 with the cover muxed in as the attached
+// picture, exactly as ffmpeg's ID3v2 APIC frame expects.
+type mp3Encoder struct{}
+
+func (mp3Encoder) extension() string { return "mp3" }
+
+func (mp3Encoder) buildCmd(ctx context.Context, ffmpegPath string, p encodeParams) *exec.Cmd {
+	args := append([]string{}, p.trimArgs()...)
+	args = append(args,
+		"-i", p.videoPath,
+		"-i", p.coverPath,
+		"-map", "0:a",
+		"-map", "1",
+		"-c:a", "libmp3lame",
+	)
+	if p.bitrate != "" {
+		args = append(args, "-b:a", p.bitrate)
+	} else {
+		quality := p.vbrQuality
+		if quality == "" {
+			quality = "0"
+		}
+		args = append(args, "-q:a", quality)
+	}
+	args = append(args, sampleRateArgs(p.sampleRate)...)
+	args = append(args, threadArgs(p.threads)...)
+	args = append(args,
+		"-id3v2_version", "3",
+		"-metadata:s:v", "title=Album cover",
+		"-metadata:s:v", "comment=Cover (front)",
+		"-disposition:v:0", "attached_pic",
+		"-metadata", "title="+p.title,
+	)
+	args = append(args, p.trackMetadataArgs()...)
+	args = append(args,
+		"-progress", "pipe:1",
+		"-nostats",
+		"-y",
+		p.outputPath,
+	)
+	return exec.CommandContext(ctx, ffmpegPath, args...)
+}
+
+func (mp3Encoder) embedCover(ctx context.Context, ffmpegPath string, p encodeParams) error {
+	return nil
+}
+
+// aacEncoder produces an AAC-in-M4A file; MP4's `disposition:v:0
+// attached_pic` works the same way it does for MP3/ID3.
+type aacEncoder struct{}
+
+func (aacEncoder) extension() string { return "m4a" }
+
+func (aacEncoder) buildCmd(ctx context.Context, ffmpegPath string, p encodeParams) *exec.Cmd {
+	bitrate := p.bitrate
+	if bitrate == "" {
+		bitrate = "192k"
+	}
+	args := append([]string{}, p.trimArgs()...)
+	args = append(args,
+		"-i", p.videoPath,
+		"-i", p.coverPath,
+		"-map", "0:a",
+		"-map", "1",
+		"-c:a", "aac",
+		"-b:a", bitrate,
+	)
+	args = append(args, sampleRateArgs(p.sampleRate)...)
+	args = append(args, threadArgs(p.threads)...)
+	args = append(args,
+		"-c:v", "mjpeg",
+		"-disposition:v:0", "attached_pic",
+		"-metadata", "title="+p.title,
+	)
+	args = append(args, p.trackMetadataArgs()...)
+	args = append(args,
+		"-progress", "pipe:1",
+		"-nostats",
+		"-y",
+		p.outputPath,
+	)
+	return exec.CommandContext(ctx, ffmpegPath, args...)
+}
+
+func (aacEncoder) embedCover(ctx context.Context, ffmpegPath string, p encodeParams) error {
+	return nil
+}
+
+// opusEncoder produces an Ogg Opus file. ffmpeg can't mux a cover directly
+// into Ogg, so the audio is encoded first and the cover is attached
+// afterwards as a METADATA_BLOCK_PICTURE comment via a remux step.
+type opusEncoder struct{}
+
+func (opusEncoder) extension() string { return "opus" }
+
+func (opusEncoder) buildCmd(ctx context.Context, ffmpegPath string, p encodeParams) *exec.Cmd {
+	bitrate := p.bitrate
+	if bitrate == "" {
+		bitrate = "128k"
+	}
+	args := append([]string{}, p.trimArgs()...)
+	args = append(args,
+		"-i", p.videoPath,
+		"-vn",
+		"-c:a", "libopus",
+		"-b:a", bitrate,
+		"-vbr", "on",
+	)
+	args = append(args, sampleRateArgs(p.sampleRate)...)
+	args = append(args, threadArgs(p.threads)...)
+	args = append(args, "-metadata", "title="+p.title)
+	args = append(args, p.trackMetadataArgs()...)
+	args = append(args,
+		"-progress", "pipe:1",
+		"-nostats",
+		"-y",
+		p.outputPath,
+	)
+	return exec.CommandContext(ctx, ffmpegPath, args...)
+}
+
+func (opusEncoder) embedCover(ctx context.Context, ffmpegPath string, p encodeParams) error {
+	return embedMetadataBlockPicture(ctx, ffmpegPath, p.outputPath, p.coverPath)
+}
+
+// flacEncoder produces a lossless FLAC file. Like Opus, the cover is
+// attached after the fact via METADATA_BLOCK_PICTURE rather than muxed in.
+type flacEncoder struct{}
+
+func (flacEncoder) extension() string { return "flac" }
+
+func (flacEncoder) buildCmd(ctx context.Context, ffmpegPath string, p encodeParams) *exec.Cmd {
+	args := append([]string{}, p.trimArgs()...)
+	args = append(args,
+		"-i", p.videoPath,
+		"-vn",
+		"-c:a", "flac",
+	)
+	args = append(args, sampleRateArgs(p.sampleRate)...)
+	args = append(args, threadArgs(p.threads)...)
+	args = append(args, "-metadata", "title="+p.title)
+	args = append(args, p.trackMetadataArgs()...)
+	args = append(args,
+		"-progress", "pipe:1",
+		"-nostats",
+		"-y",
+		p.outputPath,
+	)
+	return exec.CommandContext(ctx, ffmpegPath, args...)
+}
+
+func (flacEncoder) embedCover(ctx context.Context, ffmpegPath string, p encodeParams) error {
+	return embedMetadataBlockPicture(ctx, ffmpegPath, p.outputPath, p.coverPath)
+}
+
+// embedMetadataBlockPicture attaches coverPath to audioPath as a
+// METADATA_BLOCK_PICTURE Vorbis comment by remuxing through a temporary
+// file, since ffmpeg has no flag to set this directly.
+func embedMetadataBlockPicture(ctx context.Context, ffmpegPath, audioPath, coverPath string) error {
+	block, err := buildMetadataBlockPicture(coverPath)
+	if err != nil {
+		return fmt.Errorf("failed to build cover metadata block: %v", err)
+	}
+
+	tmpPath := audioPath + ".cover-tmp" + filepath.Ext(audioPath)
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-i", audioPath,
+		"-c", "copy",
+		"-metadata", "METADATA_BLOCK_PICTURE="+block,
+		"-y",
+		tmpPath,
+	)
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to embed cover art: %v", err)
+	}
+
+	return os.Rename(tmpPath, audioPath)
+}
+
+// buildMetadataBlockPicture builds the base64-encoded FLAC picture block
+// (https://xiph.org/flac/format.html#metadata_block_picture) carrying
+// coverPath as a "front cover" image, for use as a METADATA_BLOCK_PICTURE
+// Vorbis comment.
+func buildMetadataBlockPicture(coverPath string) (string, error) {
+	data, err := os.ReadFile(coverPath)
+	if err != nil {
+		return "", err
+	}
+
+	const (
+		pictureTypeFrontCover = 3
+		mimeType              = "image/jpeg"
+	)
+
+	var buf bytes.Buffer
+	writeUint32 := func(v uint32) { binary.Write(&buf, binary.BigEndian, v) }
+	writeString := func(s string) {
+		writeUint32(uint32(len(s)))
+		buf.WriteString(s)
+	}
+
+	writeUint32(pictureTypeFrontCover)
+	writeString(mimeType)
+	writeString("") // description
+	writeUint32(0)  // width (unknown)
+	writeUint32(0)  // height (unknown)
+	writeUint32(0)  // color depth (unknown)
+	writeUint32(0)  // number of colors (non-indexed)
+	writeUint32(uint32(len(data)))
+	buf.Write(data)
+
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,48 @@
+//go:build linux
+
+package ffmpeg
+
+import (
+	_ "embed"
+	"runtime"
+)
+
+// The files under assets/ are committed as empty placeholders; a release
+// build overwrites them with real ffmpeg/ffprobe binaries before `go
+// build`. pickByArch's len(data)==0 check makes an unpopulated placeholder
+// behave as "no embedded binary", falling through to the other resolution
+// strategies in locator.go instead of failing.
+
+//go:embed assets/ffmpeg_linux_amd64
+var embeddedFFmpegAMD64 []byte
+
+//go:embed assets/ffmpeg_linux_arm64
+var embeddedFFmpegARM64 []byte
+
+//go:embed assets/ffprobe_linux_amd64
+var embeddedFFprobeAMD64 []byte
+
+//go:embed assets/ffprobe_linux_arm64
+var embeddedFFprobeARM64 []byte
+
+func embeddedFFmpeg() ([]byte, error) {
+	return pickByArch(embeddedFFmpegAMD64, embeddedFFmpegARM64)
+}
+
+func embeddedFFprobe() ([]byte, error) {
+	return pickByArch(embeddedFFprobeAMD64, embeddedFFprobeARM64)
+}
+
+func pickByArch(amd64, arm64 []byte) ([]byte, error) {
+	var data []byte
+	switch runtime.GOARCH {
+	case "amd64":
+		data = amd64
+	case "arm64":
+		data = arm64
+	}
+	if len(data) == 0 {
+		return nil, errNoEmbeddedBinary
+	}
+	return data, nil
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package ffmpeg
+
+import _ "embed"
+
+// The files under assets/ are committed as empty placeholders; a release
+// build overwrites them with the real ffmpeg/ffprobe binaries before `go
+// build`. The len(...)==0 checks below make an unpopulated placeholder
+// behave as "no embedded binary", falling through to the other resolution
+// strategies in locator.go instead of failing.
+
+//go:embed assets/ffmpeg_windows_amd64.exe
+var embeddedFFmpegBinary []byte
+
+//go:embed assets/ffprobe_windows_amd64.exe
+var embeddedFFprobeBinary []byte
+
+func embeddedFFmpeg() ([]byte, error) {
+	if len(embeddedFFmpegBinary) == 0 {
+		return nil, errNoEmbeddedBinary
+	}
+	return embeddedFFmpegBinary, nil
+}
+
+func embeddedFFprobe() ([]byte, error) {
+	if len(embeddedFFprobeBinary) == 0 {
+		return nil, errNoEmbeddedBinary
+	}
+	return embeddedFFprobeBinary, nil
+}
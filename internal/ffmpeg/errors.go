@@ -0,0 +1,5 @@
+package ffmpeg
+
+import "errors"
+
+var errNoEmbeddedBinary = errors.New("no embedded binary for this platform")
@@ -0,0 +1,143 @@
+// Package ffmpeg resolves the ffmpeg/ffprobe binaries to use for a run.
+package ffmpeg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Options controls how a Locator resolves the ffmpeg/ffprobe binaries.
+type Options struct {
+	// FFmpegPath and FFprobePath come from --ffmpeg-path / --ffprobe-path
+	// and, if set, are tried first; a path that doesn't exist or fails to
+	// run -version falls through to the remaining resolution steps.
+	FFmpegPath  string
+	FFprobePath string
+
+	// ExtractDir is where the embedded fallback binaries are written,
+	// e.g. the tool's temp directory.
+	ExtractDir string
+}
+
+// Binary describes a resolved ffmpeg or ffprobe binary.
+type Binary struct {
+	Path    string
+	Version string
+	Source  string // how it was found, e.g. "flag", "env", "sibling", "PATH", "embedded"
+}
+
+// Locator resolves ffmpeg/ffprobe binaries using, in order: explicit flags,
+// the FFMPEG_PATH/FFPROBE_PATH env vars, a binary next to the running
+// executable, $PATH, and finally an embedded copy extracted to ExtractDir.
+type Locator struct {
+	opts Options
+}
+
+// New returns a Locator configured with opts.
+func New(opts Options) *Locator {
+	return &Locator{opts: opts}
+}
+
+// LocateFFmpeg resolves the ffmpeg binary.
+func (l *Locator) LocateFFmpeg() (Binary, error) {
+	return l.locate("ffmpeg", l.opts.FFmpegPath, "FFMPEG_PATH", embeddedFFmpeg)
+}
+
+// LocateFFprobe resolves the ffprobe binary.
+func (l *Locator) LocateFFprobe() (Binary, error) {
+	return l.locate("ffprobe", l.opts.FFprobePath, "FFPROBE_PATH", embeddedFFprobe)
+}
+
+func (l *Locator) locate(name, flagPath, envVar string, embedded func() ([]byte, error)) (Binary, error) {
+	var tried []string
+
+	if flagPath != "" {
+		tried = append(tried, fmt.Sprintf("--%s-path=%s", name, flagPath))
+		if b, err := l.verify(flagPath, "flag"); err == nil {
+			return b, nil
+		}
+	}
+
+	if envPath := os.Getenv(envVar); envPath != "" {
+		tried = append(tried, fmt.Sprintf("$%s=%s", envVar, envPath))
+		if b, err := l.verify(envPath, "env"); err == nil {
+			return b, nil
+		}
+	}
+
+	if exe, err := os.Executable(); err == nil {
+		sibling := filepath.Join(filepath.Dir(exe), exeName(name))
+		tried = append(tried, sibling)
+		if b, err := l.verify(sibling, "sibling"); err == nil {
+			return b, nil
+		}
+	}
+
+	if pathBin, err := exec.LookPath(exeName(name)); err == nil {
+		tried = append(tried, "$PATH:"+pathBin)
+		if b, err := l.verify(pathBin, "PATH"); err == nil {
+			return b, nil
+		}
+	}
+
+	extracted, err := l.extractEmbedded(name, embedded)
+	if err != nil {
+		tried = append(tried, "embedded ("+err.Error()+")")
+	} else {
+		tried = append(tried, "embedded:"+extracted)
+		if b, err := l.verify(extracted, "embedded"); err == nil {
+			return b, nil
+		}
+	}
+
+	return Binary{}, fmt.Errorf("%s not found; tried: %s", name, strings.Join(tried, ", "))
+}
+
+func (l *Locator) extractEmbedded(name string, embedded func() ([]byte, error)) (string, error) {
+	data, err := embedded()
+	if err != nil {
+		return "", err
+	}
+	if l.opts.ExtractDir == "" {
+		return "", fmt.Errorf("no extract directory configured")
+	}
+	if err := os.MkdirAll(l.opts.ExtractDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create extract directory: %w", err)
+	}
+	dest := filepath.Join(l.opts.ExtractDir, exeName(name))
+	if err := os.WriteFile(dest, data, 0755); err != nil {
+		return "", fmt.Errorf("failed to write embedded binary: %w", err)
+	}
+	return dest, nil
+}
+
+func (l *Locator) verify(path, source string) (Binary, error) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return Binary{}, fmt.Errorf("%s: not found", path)
+	}
+
+	out, err := exec.Command(path, "-version").Output()
+	if err != nil {
+		return Binary{}, fmt.Errorf("%s: failed to run -version: %w", path, err)
+	}
+
+	return Binary{Path: path, Version: parseVersion(out), Source: source}, nil
+}
+
+func parseVersion(out []byte) string {
+	line, _, _ := bytes.Cut(out, []byte("\n"))
+	return strings.TrimSpace(string(line))
+}
+
+func exeName(name string) string {
+	if runtime.GOOS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
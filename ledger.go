@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ledgerFileName is the on-disk work-item ledger, written next to the
+// output it describes so a crash or Ctrl-C can be resumed from where it
+// left off.
+const ledgerFileName = ".video2mp3-state.json"
+
+// ItemStatus is the lifecycle state of one ledger entry.
+type ItemStatus string
+
+const (
+	StatusPending    ItemStatus = "pending"
+	StatusInProgress ItemStatus = "in-progress"
+	StatusDone       ItemStatus = "done"
+	StatusFailed     ItemStatus = "failed"
+)
+
+// LedgerEntry records enough about one source file to decide, on a later
+// run, whether its output is still valid.
+type LedgerEntry struct {
+	Path       string     `json:"path"`
+	Size       int64      `json:"size"`
+	ModTime    time.Time  `json:"mtime"`
+	Sha1       string     `json:"sha1"` // sha1 of the first 64KB of the source file
+	CmdHash    string     `json:"cmd_hash"`
+	Status     ItemStatus `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	OutputPath string     `json:"output_path,omitempty"`
+	TempPaths  []string   `json:"temp_paths,omitempty"` // partial files to clean up if interrupted mid-item
+}
+
+// Ledger is a JSON-backed record of conversion progress across a batch,
+// so interrupted runs can resume instead of starting over.
+type Ledger struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]*LedgerEntry `json:"entries"`
+}
+
+// ledgerPath returns the ledger location for a given output directory.
+func ledgerPath(outputDir string) string {
+	return filepath.Join(outputDir, ledgerFileName)
+}
+
+// loadLedger reads the ledger at path, or returns a fresh empty one if it
+// doesn't exist yet.
+func loadLedger(path string) (*Ledger, error) {
+	l := &Ledger{path: path, Entries: make(map[string]*LedgerEntry)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger: %v", err)
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("failed to parse ledger: %v", err)
+	}
+	if l.Entries == nil {
+		l.Entries = make(map[string]*LedgerEntry)
+	}
+	return l, nil
+}
+
+// save flushes the ledger to disk as JSON.
+func (l *Ledger) save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.saveLocked()
+}
+
+func (l *Ledger) saveLocked() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode ledger: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create ledger directory: %v", err)
+	}
+	return os.WriteFile(l.path, data, 0644)
+}
+
+// shouldSkip reports whether relPath can be skipped because its recorded
+// entry is done and matches the current source file and command.
+func (l *Ledger) shouldSkip(relPath string, sourceHash, cmdHash string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.Entries[relPath]
+	if !ok || entry.Status != StatusDone {
+		return false
+	}
+	return entry.Sha1 == sourceHash && entry.CmdHash == cmdHash
+}
+
+// startItem marks relPath as in-progress, recording enough about the
+// source file and intended output to resume or clean up later.
+func (l *Ledger) startItem(relPath string, entry LedgerEntry) {
+	entry.Status = StatusInProgress
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Entries[relPath] = &entry
+	_ = l.saveLocked()
+}
+
+// setTempPaths records the partial/temp files an in-progress item has
+// created so far, so they can be deleted if the run is interrupted.
+func (l *Ledger) setTempPaths(relPath string, paths []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.Entries[relPath]
+	if !ok {
+		return
+	}
+	entry.TempPaths = paths
+	_ = l.saveLocked()
+}
+
+// addTempPath appends a single partial file to relPath's tracked temp
+// paths, for callers that produce them incrementally (e.g. --split writing
+// one track file at a time) rather than knowing the full set up front.
+func (l *Ledger) addTempPath(relPath, path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.Entries[relPath]
+	if !ok {
+		return
+	}
+	entry.TempPaths = append(entry.TempPaths, path)
+	_ = l.saveLocked()
+}
+
+// finishItem records the outcome of converting relPath.
+func (l *Ledger) finishItem(relPath string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.Entries[relPath]
+	if !ok {
+		return
+	}
+	if err != nil {
+		entry.Status = StatusFailed
+		entry.Error = err.Error()
+	} else {
+		entry.Status = StatusDone
+		entry.Error = ""
+		entry.TempPaths = nil
+	}
+	_ = l.saveLocked()
+}
+
+// interruptedItems returns the entries left in-progress, e.g. by a crash
+// or a prior run that was killed without a clean shutdown.
+func (l *Ledger) interruptedItems() map[string]*LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make(map[string]*LedgerEntry)
+	for relPath, entry := range l.Entries {
+		if entry.Status == StatusInProgress {
+			out[relPath] = entry
+		}
+	}
+	return out
+}
+
+// resetInterrupted rolls every in-progress entry back to pending, for use
+// both at startup (recovering from a crash) and from the signal handler
+// (recovering from Ctrl-C). It returns the entries that were reset so the
+// caller can delete their partial output files.
+func (l *Ledger) resetInterrupted() []*LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var reset []*LedgerEntry
+	for _, entry := range l.Entries {
+		if entry.Status == StatusInProgress {
+			entry.Status = StatusPending
+			reset = append(reset, entry)
+		}
+	}
+	_ = l.saveLocked()
+	return reset
+}
+
+// resetFailed rolls every failed entry back to pending, for --retry-failed.
+func (l *Ledger) resetFailed() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, entry := range l.Entries {
+		if entry.Status == StatusFailed {
+			entry.Status = StatusPending
+			entry.Error = ""
+		}
+	}
+	_ = l.saveLocked()
+}
+
+// cleanupPartials removes the output and temp files recorded against
+// entries, e.g. after resetInterrupted.
+func cleanupPartials(entries []*LedgerEntry) {
+	for _, entry := range entries {
+		if entry.OutputPath != "" {
+			os.Remove(entry.OutputPath)
+		}
+		for _, tmp := range entry.TempPaths {
+			os.Remove(tmp)
+		}
+	}
+}
+
+// maybeSkip reports whether relPath's output is already recorded as done
+// for the current source file and settings, so a resumed run can skip it.
+func maybeSkip(ledger *Ledger, inputDir, relPath, cmdHash string) (bool, error) {
+	sourceHash, err := hashFilePrefix(filepath.Join(inputDir, relPath), 64*1024)
+	if err != nil {
+		return false, err
+	}
+	return ledger.shouldSkip(relPath, sourceHash, cmdHash), nil
+}
+
+// hashFilePrefix returns the sha1 of the first n bytes of path (or the
+// whole file if it's shorter), used as a cheap fingerprint of the source.
+func hashFilePrefix(path string, n int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha1.New()
+	if _, err := io.CopyN(h, f, n); err != nil && err != io.EOF {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashCmd fingerprints the settings that affect a file's output, so a
+// ledger entry from a run with different flags is never mistaken for one
+// that's still valid.
+func hashCmd(parts ...string) string {
+	h := sha1.New()
+	io.WriteString(h, strings.Join(parts, "\x00"))
+	return hex.EncodeToString(h.Sum(nil))
+}
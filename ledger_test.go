@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHashCmdStableAndDistinct(t *testing.T) {
+	a := hashCmd("mp3", "192k", "", "0")
+	b := hashCmd("mp3", "192k", "", "0")
+	if a != b {
+		t.Fatalf("hashCmd not stable for identical inputs: %q != %q", a, b)
+	}
+
+	c := hashCmd("aac", "192k", "", "0")
+	if a == c {
+		t.Fatalf("hashCmd collided for different inputs: %q", a)
+	}
+}
+
+func TestLedgerShouldSkip(t *testing.T) {
+	l := &Ledger{Entries: make(map[string]*LedgerEntry)}
+	cmdHash := hashCmd("mp3", "192k")
+
+	if l.shouldSkip("a.mp4", "sha1", cmdHash) {
+		t.Fatalf("shouldSkip true for an entry that doesn't exist yet")
+	}
+
+	l.startItem("a.mp4", LedgerEntry{Sha1: "sha1", CmdHash: cmdHash})
+	if l.shouldSkip("a.mp4", "sha1", cmdHash) {
+		t.Fatalf("shouldSkip true for an in-progress entry")
+	}
+
+	l.finishItem("a.mp4", nil)
+	if !l.shouldSkip("a.mp4", "sha1", cmdHash) {
+		t.Fatalf("shouldSkip false for a done entry with matching source and cmd hash")
+	}
+	if l.shouldSkip("a.mp4", "sha1-changed", cmdHash) {
+		t.Fatalf("shouldSkip true despite a changed source hash")
+	}
+	if l.shouldSkip("a.mp4", "sha1", hashCmd("aac", "192k")) {
+		t.Fatalf("shouldSkip true despite a changed cmd hash")
+	}
+}
+
+func TestLedgerFinishItemRecordsFailure(t *testing.T) {
+	l := &Ledger{Entries: make(map[string]*LedgerEntry)}
+	l.startItem("a.mp4", LedgerEntry{Sha1: "sha1", CmdHash: "hash"})
+
+	want := "boom"
+	l.finishItem("a.mp4", errors.New(want))
+
+	entry := l.Entries["a.mp4"]
+	if entry.Status != StatusFailed {
+		t.Fatalf("status = %q, want %q", entry.Status, StatusFailed)
+	}
+	if entry.Error != want {
+		t.Fatalf("error = %q, want %q", entry.Error, want)
+	}
+}
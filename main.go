@@ -1,14 +1,21 @@
 package main
 
 import (
-	_ "embed"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shangyanjin/video2mp3/internal/ffmpeg"
 )
 
 const (
@@ -16,21 +23,6 @@ const (
 	defaultOutputDir = "output"
 	tempDir          = "temp"
 
-	// Start worker goroutines
-	numWorkers = 4
-
-	// FFmpeg related paths
-	ffmpegRootDir = "ffmpeg"
-	ffmpegBinDir  = ffmpegRootDir + "/bin"
-	ffmpegExe     = ffmpegBinDir + "/ffmpeg.exe"
-	ffprobeExe    = ffmpegBinDir + "/ffprobe.exe"
-
-	// Error messages
-	errFFmpegNotFound = "FFmpeg not found. Please ensure FFmpeg is installed in the correct directory"
-
-	// Progress bar settings
-	progressWidth = 40
-
 	// Default settings
 	defaultScreenshotTime = 1.0 // Default screenshot at 1 second
 	defaultFrameCount     = 25  // Default number of frames for animated cover
@@ -39,66 +31,9 @@ const (
 	// Application info
 	appName    = "Video2MP3"
 	appVersion = "v2025.02.01"
-	appDesc    = "Convert video to MP3 with cover image"
+	appDesc    = "Convert video to audio (MP3/AAC/Opus/FLAC) with cover image"
 )
 
-//go:embed assets/ffmpeg.exe
-var ffmpegBinary []byte
-
-//go:embed assets/ffprobe.exe
-var ffprobeBinary []byte
-
-type ConversionStatus struct {
-	total     int
-	completed int
-	mutex     sync.Mutex
-}
-
-func (cs *ConversionStatus) increment() {
-	cs.mutex.Lock()
-	cs.completed++
-	cs.displayProgress()
-	cs.mutex.Unlock()
-}
-
-func (cs *ConversionStatus) displayProgress() {
-	percentage := float64(cs.completed) * 100 / float64(cs.total)
-	completed := int(float64(progressWidth) * float64(cs.completed) / float64(cs.total))
-
-	fmt.Printf("\r[")
-	for i := 0; i < progressWidth; i++ {
-		if i < completed {
-			fmt.Print("=")
-		} else if i == completed {
-			fmt.Print(">")
-		} else {
-			fmt.Print(" ")
-		}
-	}
-	fmt.Printf("] %.1f%% (%d/%d)", percentage, cs.completed, cs.total)
-}
-
-func ensureFFmpeg() error {
-	// Create temp directory if it doesn't exist
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return fmt.Errorf("failed to create temp directory: %v", err)
-	}
-
-	// Set FFmpeg paths to temp directory
-	ffmpegPath := filepath.Join(tempDir, "ffmpeg.exe")
-	ffprobePath := filepath.Join(tempDir, "ffprobe.exe")
-
-	// Write FFmpeg binaries to temp directory
-	if err := os.WriteFile(ffmpegPath, ffmpegBinary, 0755); err != nil {
-		return fmt.Errorf("failed to write ffmpeg binary: %v", err)
-	}
-	if err := os.WriteFile(ffprobePath, ffprobeBinary, 0755); err != nil {
-		return fmt.Errorf("failed to write ffprobe binary: %v", err)
-	}
-
-	return nil
-}
-
 func cleanup() {
 	os.RemoveAll(tempDir)
 }
@@ -107,9 +42,42 @@ func main() {
 	// Define command line arguments
 	inputDir := flag.String("d", ".", "Input directory path")
 	outputDir := flag.String("o", "", "Output directory path")
-	screenshotTime := flag.Float64("t", defaultScreenshotTime, "Screenshot time in seconds (e.g., 3.5)")
+	screenshotTime := flag.Float64("t", defaultScreenshotTime, "Cover art start time in seconds (e.g., 3.5)")
+	ffmpegPathFlag := flag.String("ffmpeg-path", "", "Path to the ffmpeg binary (tried before auto-discovery)")
+	ffprobePathFlag := flag.String("ffprobe-path", "", "Path to the ffprobe binary (tried before auto-discovery)")
+	quiet := flag.Bool("quiet", false, "Suppress progress output")
+	jsonOutput := flag.Bool("json", false, "Emit newline-delimited JSON progress events instead of a progress bar")
+	formatFlag := flag.String("format", string(FormatMP3), "Output format: mp3, aac, opus, or flac")
+	bitrate := flag.String("bitrate", "", "Audio bitrate, e.g. 192k (default depends on format)")
+	vbrQuality := flag.String("vbr-quality", "", "libmp3lame VBR quality 0-9, 0 is best (mp3 only)")
+	sampleRate := flag.Int("sample-rate", 0, "Output sample rate in Hz (0 keeps the source rate)")
+	coverModeFlag := flag.String("cover-mode", string(CoverModeStill), "Cover art mode: still, apng, gif, or mp4-thumb")
+	coverFrames := flag.Int("cover-frames", defaultFrameCount, "Number of frames sampled for animated cover modes")
+	coverInterval := flag.Float64("cover-interval", defaultFrameInterval, "Seconds between sampled frames for animated cover modes")
+	coverGrid := flag.Bool("cover-grid", false, "Also emit a 5x5 contact-sheet preview image")
+	force := flag.Bool("force", false, "Ignore the work-item ledger and reconvert everything")
+	retryFailed := flag.Bool("retry-failed", false, "Re-attempt only files that failed on a prior run")
+	split := flag.Bool("split", false, "Split output by chapter (or silence, if the source has no chapters)")
+	minTrackLen := flag.Float64("min-track-len", 10, "Minimum seconds for a silence-detected track (short gaps are merged into the next track)")
+	maxTrackLen := flag.Float64("max-track-len", 0, "Maximum seconds for a silence-detected track before it's cut evenly (0 disables the limit)")
+	silenceNoise := flag.String("silence-noise", "-30dB", "silencedetect noise threshold used to find track boundaries when splitting without chapters")
+	silenceDur := flag.Float64("silence-duration", 0.8, "Minimum silence length in seconds to count as a track boundary when splitting without chapters")
+	jobs := flag.Int("j", runtime.NumCPU(), "Number of files to convert concurrently (also --jobs)")
+	flag.IntVar(jobs, "jobs", runtime.NumCPU(), "Number of files to convert concurrently (also -j)")
+	ffmpegThreads := flag.Int("ffmpeg-threads", 0, "Threads each ffmpeg process may use; keep jobs*ffmpeg-threads within your CPU count (0 leaves ffmpeg's own default)")
 	flag.Parse()
 
+	format, err := parseFormat(*formatFlag)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	coverMode, err := parseCoverMode(*coverModeFlag)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
 	// Determine actual output directory
 	actualOutputDir := defaultOutputDir
 	if *outputDir != "" {
@@ -120,11 +88,23 @@ func main() {
 	fmt.Printf("%s %s - %s\n", appName, appVersion, appDesc)
 	fmt.Printf("Input: %s\nOutput: %s\n\n", *inputDir, actualOutputDir)
 
-	// Extract FFmpeg binaries
-	if err := ensureFFmpeg(); err != nil {
-		fmt.Printf("Error setting up FFmpeg: %v\n", err)
+	// Resolve ffmpeg/ffprobe: flags, env, sibling binary, PATH, then embedded fallback
+	locator := ffmpeg.New(ffmpeg.Options{
+		FFmpegPath:  *ffmpegPathFlag,
+		FFprobePath: *ffprobePathFlag,
+		ExtractDir:  tempDir,
+	})
+	ffmpegBin, err := locator.LocateFFmpeg()
+	if err != nil {
+		fmt.Printf("Error locating ffmpeg: %v\n", err)
 		return
 	}
+	ffprobeBin, err := locator.LocateFFprobe()
+	if err != nil {
+		fmt.Printf("Error locating ffprobe: %v\n", err)
+		return
+	}
+	fmt.Printf("Using ffmpeg %s (%s)\nUsing ffprobe %s (%s)\n\n", ffmpegBin.Version, ffmpegBin.Source, ffprobeBin.Version, ffprobeBin.Source)
 	defer cleanup()
 
 	// Validate screenshot time
@@ -133,12 +113,31 @@ func main() {
 		return
 	}
 
-	if err := run(*inputDir, *outputDir, *screenshotTime); err != nil {
+	encodeOpts := encodeFlags{format: format, bitrate: *bitrate, vbrQuality: *vbrQuality, sampleRate: *sampleRate, threads: *ffmpegThreads}
+	coverOpts := coverOptions{
+		mode:          coverMode,
+		startTime:     *screenshotTime,
+		frameCount:    *coverFrames,
+		frameInterval: *coverInterval,
+		grid:          *coverGrid,
+	}
+	splitOpts := splitOptions{
+		enabled:      *split,
+		minTrackLen:  *minTrackLen,
+		maxTrackLen:  *maxTrackLen,
+		silenceNoise: *silenceNoise,
+		silenceDur:   *silenceDur,
+	}
+	jobCount := *jobs
+	if jobCount < 1 {
+		jobCount = 1
+	}
+	if err := run(*inputDir, *outputDir, ffmpegBin.Path, ffprobeBin.Path, *quiet, *jsonOutput, encodeOpts, coverOpts, splitOpts, *force, *retryFailed, jobCount); err != nil {
 		fmt.Printf("Error: %v\n", err)
 	}
 }
 
-func run(inputDir, outputDir string, screenshotTime float64) error {
+func run(inputDir, outputDir, ffmpegPath, ffprobePath string, quiet, jsonOutput bool, encodeOpts encodeFlags, coverOpts coverOptions, splitOpts splitOptions, force, retryFailed bool, jobs int) error {
 	// If output directory is empty, use default output directory
 	if outputDir == "" {
 		outputDir = defaultOutputDir
@@ -149,9 +148,39 @@ func run(inputDir, outputDir string, screenshotTime float64) error {
 		return fmt.Errorf("failed to create output directory: %v", err)
 	}
 
+	ledger, err := loadLedger(ledgerPath(outputDir))
+	if err != nil {
+		return err
+	}
+	if force {
+		ledger.Entries = make(map[string]*LedgerEntry)
+	}
+	if retryFailed {
+		ledger.resetFailed()
+	}
+	// Anything still marked in-progress belongs to a run that never shut
+	// down cleanly; its partial output can't be trusted.
+	cleanupPartials(ledger.resetInterrupted())
+
+	pipeline := newPipeline(jobs)
+
+	// Recover from Ctrl-C / SIGTERM: cancel the pipeline context so running
+	// ffmpeg children are killed, roll in-flight items back to pending,
+	// delete their partial outputs, and flush the ledger before exiting.
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		fmt.Println("\nInterrupted, saving progress...")
+		pipeline.Cancel()
+		cleanupPartials(ledger.resetInterrupted())
+		_ = ledger.save()
+		os.Exit(130)
+	}()
+
 	// Count total video files first
 	totalFiles := 0
-	err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -168,31 +197,23 @@ func run(inputDir, outputDir string, screenshotTime float64) error {
 		return fmt.Errorf("failed to count files: %v", err)
 	}
 
-	status := &ConversionStatus{
-		total: totalFiles,
-	}
+	reporter := newProgressReporter(jobs, totalFiles, quiet, jsonOutput)
 
-	// Create channels
-	videoFiles := make(chan string)
-	errors := make(chan error, 1)
-	done := make(chan bool)
-
-	// Start worker goroutines
-	for i := 0; i < numWorkers; i++ {
-		go func() {
-			for relPath := range videoFiles {
-				if err := convertToMP3(relPath, inputDir, outputDir, screenshotTime); err != nil {
-					fmt.Printf("\nConversion failed for %s: %v\n", relPath, err)
-				}
-				status.increment()
-			}
-			done <- true
-		}()
-	}
+	cmdHash := hashCmd(
+		string(encodeOpts.format), encodeOpts.bitrate, encodeOpts.vbrQuality, fmt.Sprintf("%d", encodeOpts.sampleRate),
+		string(coverOpts.mode), fmt.Sprintf("%f", coverOpts.startTime), fmt.Sprintf("%d", coverOpts.frameCount),
+		fmt.Sprintf("%f", coverOpts.frameInterval), fmt.Sprintf("%t", coverOpts.grid),
+		fmt.Sprintf("%t", splitOpts.enabled), fmt.Sprintf("%f", splitOpts.minTrackLen), fmt.Sprintf("%f", splitOpts.maxTrackLen),
+		splitOpts.silenceNoise, fmt.Sprintf("%f", splitOpts.silenceDur),
+	)
 
-	// Walk through directory in a separate goroutine
+	// Walk through directory in a separate goroutine, feeding the pipeline's
+	// buffered queue; a traversal error is kept in walkErr and reported once
+	// the pipeline drains, instead of needing its own channel.
+	videoFiles := make(chan string)
+	var walkErr error
 	go func() {
-		err := filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
+		walkErr = filepath.Walk(inputDir, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
@@ -210,31 +231,42 @@ func run(inputDir, outputDir string, screenshotTime float64) error {
 			}
 			return nil
 		})
-
-		if err != nil {
-			errors <- fmt.Errorf("failed to traverse directory: %v", err)
+		if walkErr != nil {
+			walkErr = fmt.Errorf("failed to traverse directory: %v", walkErr)
 		}
 		close(videoFiles)
 	}()
 
-	// Wait for all workers to finish
-	for i := 0; i < numWorkers; i++ {
-		<-done
-	}
+	errs := pipeline.Run(videoFiles, func(worker int, relPath string) error {
+		if skipped, err := maybeSkip(ledger, inputDir, relPath, cmdHash); err != nil {
+			fmt.Printf("\nFailed to check ledger for %s: %v\n", relPath, err)
+		} else if skipped {
+			reporter.Done(worker, relPath, nil)
+			return nil
+		}
+
+		reporter.Start(worker, relPath)
+		err := convertToMP3(pipeline.Context(), relPath, inputDir, outputDir, ffmpegPath, ffprobePath, worker, reporter, encodeOpts, coverOpts, splitOpts, ledger, cmdHash)
+		if err != nil {
+			fmt.Printf("\nConversion failed for %s: %v\n", relPath, err)
+		}
+		reporter.Done(worker, relPath, err)
+		return err
+	})
 
 	// Print final newline
 	fmt.Println()
 
-	// Check if there were any errors during directory traversal
-	select {
-	case err := <-errors:
-		return err
-	default:
-		return nil
+	if walkErr != nil {
+		return walkErr
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d file(s) failed to convert", len(errs))
 	}
+	return nil
 }
 
-func convertToMP3(relPath, inputDir, outputDir string, screenshotTime float64) error {
+func convertToMP3(ctx context.Context, relPath, inputDir, outputDir string, ffmpegPath, ffprobePath string, worker int, reporter ProgressReporter, encodeOpts encodeFlags, coverOpts coverOptions, splitOpts splitOptions, ledger *Ledger, cmdHash string) (err error) {
 	// Get full input path
 	videoPath := filepath.Join(inputDir, relPath)
 
@@ -248,49 +280,111 @@ func convertToMP3(relPath, inputDir, outputDir string, screenshotTime float64) e
 	filename := filepath.Base(videoPath)
 	nameWithoutExt := strings.TrimSuffix(filename, filepath.Ext(filename))
 
-	// Temporary cover image path
-	coverPath := filepath.Join(tempDir, nameWithoutExt+"-cover.jpg")
-	// Output MP3 path preserving directory structure
-	mp3Path := filepath.Join(outPath, nameWithoutExt+".mp3")
-
-	ffmpegPath := filepath.Join(tempDir, "ffmpeg.exe")
-	startTime := fmt.Sprintf("%f", screenshotTime)
-
-	// Extract single frame as cover with high quality
-	cmdCover := exec.Command(ffmpegPath,
-		"-ss", startTime,
-		"-i", videoPath,
-		"-vframes", "1",
-		"-vf", "scale=1024:-1", // Increased resolution to 1024px width
-		"-q:v", "1", // Highest quality (1-31, lower is better)
-		"-qmin", "1", // Force minimum quantization to highest quality
-		"-qmax", "1", // Force maximum quantization to highest quality
-		"-y", // Overwrite output file
-		coverPath)
-
-	if err := cmdCover.Run(); err != nil {
-		return fmt.Errorf("failed to extract cover: %v", err)
-	}
-
-	// Convert to MP3 and add cover
-	cmdMP3 := exec.Command(ffmpegPath,
-		"-i", videoPath,
-		"-i", coverPath,
-		"-map", "0:a",
-		"-map", "1",
-		"-c:a", "libmp3lame",
-		"-q:a", "0", // Highest quality MP3
-		"-id3v2_version", "3",
-		"-metadata:s:v", "title=Album cover",
-		"-metadata:s:v", "comment=Cover (front)",
-		"-disposition:v:0", "attached_pic",
-		"-metadata", "title="+nameWithoutExt,
-		"-y", // Overwrite output file
-		mp3Path)
-
-	if err := cmdMP3.Run(); err != nil {
+	enc, err := newEncoder(encodeOpts.format)
+	if err != nil {
+		return err
+	}
+	// Output path preserving directory structure, extension picked by codec
+	outputPath := filepath.Join(outPath, nameWithoutExt+"."+enc.extension())
+
+	info, err := os.Stat(videoPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat source file: %v", err)
+	}
+	sourceHash, err := hashFilePrefix(videoPath, 64*1024)
+	if err != nil {
+		return fmt.Errorf("failed to hash source file: %v", err)
+	}
+	ledger.startItem(relPath, LedgerEntry{
+		Path:       videoPath,
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		Sha1:       sourceHash,
+		CmdHash:    cmdHash,
+		OutputPath: outputPath,
+	})
+	defer func() { ledger.finishItem(relPath, err) }()
+
+	cover, err := extractCover(ctx, ffmpegPath, videoPath, tempDir, nameWithoutExt, coverOpts)
+	if err != nil {
+		return err
+	}
+	coverPath := cover.stillPath
+	ledger.setTempPaths(relPath, []string{coverPath})
+	if cover.sidecarPath != "" {
+		sidecar := filepath.Join(outPath, nameWithoutExt+filepath.Ext(cover.sidecarPath))
+		if err := os.Rename(cover.sidecarPath, sidecar); err != nil {
+			os.Remove(coverPath)
+			return fmt.Errorf("failed to move animated cover sidecar: %v", err)
+		}
+	}
+	if cover.gridPath != "" {
+		grid := filepath.Join(outPath, nameWithoutExt+"-contact.jpg")
+		if err := os.Rename(cover.gridPath, grid); err != nil {
+			os.Remove(coverPath)
+			return fmt.Errorf("failed to move cover grid: %v", err)
+		}
+	}
+
+	durationMs, err := probeDurationMs(ctx, ffprobePath, videoPath)
+	if err != nil {
+		// Progress will just stay at 0% if we can't learn the duration; this
+		// is not fatal, so fall through and convert anyway.
+		durationMs = 0
+	}
+
+	if splitOpts.enabled {
+		chapters, err := planChapters(ctx, ffmpegPath, ffprobePath, videoPath, durationMs, splitOpts)
+		if err != nil {
+			os.Remove(coverPath)
+			return err
+		}
+		if err := convertSplit(ctx, ffmpegPath, enc, videoPath, coverPath, outPath, nameWithoutExt, chapters, encodeOpts, worker, reporter, ledger, relPath); err != nil {
+			os.Remove(coverPath)
+			return err
+		}
+		os.Remove(coverPath)
+		return nil
+	}
+
+	encParams := encodeParams{
+		videoPath:  videoPath,
+		coverPath:  coverPath,
+		outputPath: outputPath,
+		title:      nameWithoutExt,
+		bitrate:    encodeOpts.bitrate,
+		vbrQuality: encodeOpts.vbrQuality,
+		sampleRate: encodeOpts.sampleRate,
+		threads:    encodeOpts.threads,
+	}
+
+	// Encode the audio, reporting progress as ffmpeg emits it
+	cmd := enc.buildCmd(ctx, ffmpegPath, encParams)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to attach progress pipe: %v", err)
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		os.Remove(coverPath)
+		return fmt.Errorf("failed to start conversion: %v", err)
+	}
+
+	readProgress(stdout, durationMs, func(pct float64, speed string) {
+		reporter.Update(worker, relPath, pct, speed, etaMs(pct, time.Since(start)))
+	})
+
+	if err := cmd.Wait(); err != nil {
 		os.Remove(coverPath) // Clean up cover image
-		return fmt.Errorf("failed to convert to MP3: %v", err)
+		return fmt.Errorf("failed to convert: %v", err)
+	}
+
+	// Codecs that couldn't mux the cover in directly attach it now
+	if err := enc.embedCover(ctx, ffmpegPath, encParams); err != nil {
+		os.Remove(coverPath)
+		return err
 	}
 
 	// Delete temporary cover image
@@ -298,3 +392,32 @@ func convertToMP3(relPath, inputDir, outputDir string, screenshotTime float64) e
 
 	return nil
 }
+
+// probeDurationMs returns the duration of videoPath in milliseconds, read
+// from ffprobe's format metadata.
+func probeDurationMs(ctx context.Context, ffprobePath, videoPath string) (int64, error) {
+	out, err := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-show_format",
+		"-print_format", "json",
+		videoPath,
+	).Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to probe duration: %v", err)
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return 0, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+
+	seconds, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse duration %q: %v", probe.Format.Duration, err)
+	}
+	return int64(seconds * 1000), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Pipeline runs a bounded pool of workers over a stream of work items. It
+// replaces a fixed-size worker count with one sized to the CPU count (or
+// --jobs), buffers the work queue for back-pressure instead of handing
+// items straight to an unbuffered channel, and carries a context that's
+// canceled on shutdown so in-flight exec.CommandContext children are
+// killed instead of orphaned.
+type Pipeline struct {
+	Jobs int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newPipeline creates a Pipeline with jobs workers.
+func newPipeline(jobs int) *Pipeline {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Pipeline{Jobs: jobs, ctx: ctx, cancel: cancel}
+}
+
+// Context is canceled by Cancel; pass it to exec.CommandContext so running
+// ffmpeg/ffprobe children are killed promptly on shutdown.
+func (p *Pipeline) Context() context.Context {
+	return p.ctx
+}
+
+// Cancel stops accepting new work and cancels Context, killing any
+// exec.CommandContext children started with it.
+func (p *Pipeline) Cancel() {
+	p.cancel()
+}
+
+// Run feeds items through work using p.Jobs workers pulling from a
+// buffered queue sized 2*Jobs, and collects every error (rather than just
+// the first) into the returned slice. work is given the 0-based worker
+// index so callers can attribute progress reporting per-slot.
+func (p *Pipeline) Run(items <-chan string, work func(worker int, relPath string) error) []error {
+	queue := make(chan string, 2*p.Jobs)
+	go func() {
+		defer close(queue)
+		for item := range items {
+			select {
+			case queue <- item:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	wg.Add(p.Jobs)
+	for i := 0; i < p.Jobs; i++ {
+		worker := i
+		go func() {
+			defer wg.Done()
+			for relPath := range queue {
+				if p.ctx.Err() != nil {
+					return
+				}
+				if err := work(worker, relPath); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errs
+}
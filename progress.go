@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressReporter receives per-worker progress events as ffmpeg reports them.
+// Implementations must be safe for concurrent use by multiple workers.
+type ProgressReporter interface {
+	// Start is called once a worker begins converting a file.
+	Start(worker int, file string)
+	// Update is called for each progress sample ffmpeg emits.
+	Update(worker int, file string, pct float64, speed string, etaMs int64)
+	// Done is called once a worker finishes a file, successfully or not.
+	Done(worker int, file string, err error)
+}
+
+// newProgressReporter picks the reporter implementation for the given flags.
+func newProgressReporter(workers, total int, quiet, jsonOutput bool) ProgressReporter {
+	switch {
+	case jsonOutput:
+		return &jsonReporter{out: os.Stdout}
+	case quiet:
+		return &nullReporter{}
+	default:
+		return newBarReporter(workers, total)
+	}
+}
+
+// nullReporter discards all progress events, used with --quiet.
+type nullReporter struct{}
+
+func (*nullReporter) Start(int, string)                          {}
+func (*nullReporter) Update(int, string, float64, string, int64) {}
+func (*nullReporter) Done(int, string, error)                    {}
+
+// jsonEvent is one newline-delimited JSON progress event emitted with --json.
+type jsonEvent struct {
+	File  string  `json:"file"`
+	Pct   float64 `json:"pct"`
+	Speed string  `json:"speed,omitempty"`
+	EtaMs int64   `json:"eta_ms,omitempty"`
+	Done  bool    `json:"done,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// jsonReporter writes one JSON object per line to out, for scripting.
+type jsonReporter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (r *jsonReporter) Start(worker int, file string) {}
+
+func (r *jsonReporter) Update(worker int, file string, pct float64, speed string, etaMs int64) {
+	r.emit(jsonEvent{File: file, Pct: pct, Speed: speed, EtaMs: etaMs})
+}
+
+func (r *jsonReporter) Done(worker int, file string, err error) {
+	evt := jsonEvent{File: file, Pct: 100, Done: true}
+	if err != nil {
+		evt.Error = err.Error()
+	}
+	r.emit(evt)
+}
+
+func (r *jsonReporter) emit(evt jsonEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	enc := json.NewEncoder(r.out)
+	_ = enc.Encode(evt)
+}
+
+// barReporter renders one progress line per worker plus a totals line,
+// redrawn in place with ANSI cursor movement.
+type barReporter struct {
+	mu      sync.Mutex
+	workers int
+	total   int      // total number of files being converted
+	lines   []string // last rendered line per worker, index = worker id
+	done    int
+	redrawn bool // whether the block has been painted at least once
+}
+
+func newBarReporter(workers, total int) *barReporter {
+	return &barReporter{
+		workers: workers,
+		total:   total,
+		lines:   make([]string, workers),
+	}
+}
+
+func (r *barReporter) Start(worker int, file string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[worker] = fmt.Sprintf("[worker %d] %s: starting", worker, file)
+	r.redraw()
+}
+
+func (r *barReporter) Update(worker int, file string, pct float64, speed string, etaMs int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	eta := time.Duration(etaMs) * time.Millisecond
+	r.lines[worker] = fmt.Sprintf("[worker %d] %s: %5.1f%% %s eta %s", worker, file, pct, speed, eta.Round(time.Second))
+	r.redraw()
+}
+
+func (r *barReporter) Done(worker int, file string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done++
+	if err != nil {
+		r.lines[worker] = fmt.Sprintf("[worker %d] %s: failed: %v", worker, file, err)
+	} else {
+		r.lines[worker] = fmt.Sprintf("[worker %d] %s: done", worker, file)
+	}
+	r.redraw()
+}
+
+// redraw repaints all worker lines plus a totals line in place, moving the
+// cursor back up to the first line before the next redraw. Must be called
+// with r.mu held.
+func (r *barReporter) redraw() {
+	// Move cursor up to the top of the block we last printed (if any).
+	if r.redrawn {
+		fmt.Printf("\033[%dA", r.workers+1)
+	}
+	for _, line := range r.lines {
+		fmt.Printf("\033[2K%s\n", line)
+	}
+	fmt.Printf("\033[2Ktotal: %d/%d files done\n", r.done, r.total)
+	r.redrawn = true
+}
+
+// parseProgressLine updates dst in place from one `-progress pipe:1` key=value
+// line. It returns true once a "progress=end" line is seen.
+func parseProgressLine(line string, durationMs int64, dst *ffmpegProgress) bool {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return false
+	}
+	value = strings.TrimSpace(value)
+	switch key {
+	case "out_time_ms":
+		// Despite the key's name, ffmpeg reports this in microseconds, not
+		// milliseconds; convert before comparing against durationMs or the
+		// percentage overshoots by ~1000x and clamps to 100 almost instantly.
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+			ms := us / 1000
+			dst.OutTimeMs = ms
+			if durationMs > 0 {
+				dst.Pct = float64(ms) / float64(durationMs) * 100
+				if dst.Pct > 100 {
+					dst.Pct = 100
+				}
+			}
+		}
+	case "speed":
+		dst.Speed = strings.TrimSuffix(value, "x") + "x"
+		if value == "" || value == "N/A" {
+			dst.Speed = ""
+		}
+	case "progress":
+		return value == "end"
+	}
+	return false
+}
+
+// ffmpegProgress is the running state parsed out of an ffmpeg `-progress
+// pipe:1` stream for a single conversion.
+type ffmpegProgress struct {
+	OutTimeMs int64
+	Speed     string
+	Pct       float64
+}
+
+// readProgress consumes key=value lines from r, calling report for each
+// sample, until the stream ends or a "progress=end" line is seen.
+func readProgress(r io.Reader, durationMs int64, report func(pct float64, speed string)) {
+	state := &ffmpegProgress{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if parseProgressLine(scanner.Text(), durationMs, state) {
+			report(100, state.Speed)
+			return
+		}
+		if state.Speed != "" || state.OutTimeMs > 0 {
+			report(state.Pct, state.Speed)
+		}
+	}
+}
+
+func etaMs(pct float64, elapsed time.Duration) int64 {
+	if pct <= 0 || pct >= 100 {
+		return 0
+	}
+	remainingFraction := (100 - pct) / pct
+	return int64(float64(elapsed.Milliseconds()) * remainingFraction)
+}
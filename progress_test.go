@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestParseProgressLineConvertsMicrosecondsToMs(t *testing.T) {
+	dst := &ffmpegProgress{}
+	// ffmpeg's out_time_ms key is actually microseconds: 30s in is
+	// 30_000_000, against a 60_000ms (60s) duration that's 50%, not 50000%.
+	parseProgressLine("out_time_ms=30000000", 60_000, dst)
+
+	if dst.OutTimeMs != 30_000 {
+		t.Fatalf("OutTimeMs = %d, want 30000ms", dst.OutTimeMs)
+	}
+	if dst.Pct < 49.9 || dst.Pct > 50.1 {
+		t.Fatalf("Pct = %v, want ~50", dst.Pct)
+	}
+}
+
+func TestParseProgressLinePctClampsAt100(t *testing.T) {
+	dst := &ffmpegProgress{}
+	parseProgressLine("out_time_ms=90000000", 60_000, dst)
+	if dst.Pct != 100 {
+		t.Fatalf("Pct = %v, want 100 (clamped)", dst.Pct)
+	}
+}
+
+func TestParseProgressLineEnd(t *testing.T) {
+	dst := &ffmpegProgress{}
+	if parseProgressLine("speed=1.2x", 0, dst); dst.Speed != "1.2x" {
+		t.Fatalf("Speed = %q, want %q", dst.Speed, "1.2x")
+	}
+	if !parseProgressLine("progress=end", 0, dst) {
+		t.Fatal("parseProgressLine did not report end of stream")
+	}
+}
